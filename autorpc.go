@@ -10,17 +10,43 @@ type Connection interface {
 	GetValue(val interface{}) (interface{}, error)
 	AssignValue(val interface{}) error
 	StopHandling()
+	// Publish sends msg to this connection's peer as a pub/sub message on
+	// topic, to be delivered to any subscriber the peer registered for it.
+	Publish(topic string, msg interface{}) error
+	// Remote returns this connection's instance of the reflected remote
+	// proxy built for val's type by ServiceBuilder.UseRemote, for calling
+	// back into whatever the peer on this specific connection exposed.
+	Remote(val interface{}) (interface{}, error)
 }
 
 type Service interface {
 	http.Handler
 	// HandleConnection handles the lifetime of a connection
 	HandleConnection(conn net.Conn, initFn func(Connection)) error
+	// Broadcast publishes msg on topic to every connection the service is
+	// currently handling.
+	Broadcast(topic string, msg interface{})
 }
 
 type ServiceBuilder interface {
 	EachConnectionAssign(val interface{}, createFn func(Connection) interface{}) ServiceBuilder
 	UseRemote(val interface{}) ServiceBuilder
+	// WithCodec overrides the default JSON wire codec used for this
+	// service's call arguments and return values. Content negotiation
+	// (ServeHTTP) and the connection handshake (HandleConnection) can still
+	// select a different builtin codec per connection.
+	WithCodec(codec Codec) ServiceBuilder
+	// RegisterSubscriber registers handler as the subscriber for topic: it
+	// is called with the published message whenever a peer publishes on
+	// that topic over any connection this service handles.
+	RegisterSubscriber(topic string, handler interface{}) ServiceBuilder
+	// Use adds interceptor to the chain wrapped around every inbound API
+	// call and outbound UseRemote call. Interceptors run in registration
+	// order, outermost first.
+	Use(interceptor Interceptor) ServiceBuilder
+	// WithRegistry makes the built Service self-register as name at addr in
+	// registry the first time it starts handling connections.
+	WithRegistry(registry Registry, name, addr string) ServiceBuilder
 	Build() Service
 }
 
@@ -28,6 +54,15 @@ func NewServiceBuilder(ptr interface{}) ServiceBuilder {
 	return newServiceBuilder(ptr)
 }
 
+// Stream represents an in-progress streaming RPC call. It is handed to the
+// caller alongside the receive channel so the call can be aborted before the
+// remote side has finished sending values.
+type Stream interface {
+	// Cancel stops consuming the stream, closes the receive channel and
+	// notifies the remote side that no further items are wanted.
+	Cancel()
+}
+
 type Object interface {
 	GetValue() interface{}
 }
@@ -1,10 +1,11 @@
 package autorpc
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
 	"reflect"
+	"sync/atomic"
+	"time"
 )
 
 type serviceBuilder struct {
@@ -12,6 +13,11 @@ type serviceBuilder struct {
 	remotes []reflect.Type
 }
 
+func (sb *serviceBuilder) WithCodec(codec Codec) ServiceBuilder {
+	sb.service.codec = codec
+	return sb
+}
+
 func (sb *serviceBuilder) EachConnectionAssign(val interface{}, createFn func(Connection) interface{}) ServiceBuilder {
 	valType := reflect.TypeOf(val)
 	if createFn == nil {
@@ -46,6 +52,12 @@ func (sb *serviceBuilder) RegisterRemoteObject(val interface{}) ServiceBuilder {
 	panic("RegisterRemoteObject not implemented yet.")
 }
 
+// UseRemote registers val's type as a reflected remote proxy, built once per
+// connection and reachable through Connection.Remote. Since the transport is
+// symmetric, a ServiceBuilder can combine UseRemote with an API pointer so
+// either side of a connection can call into the other: a server can expose
+// an API for its clients to call and also UseRemote a callback struct the
+// client implements, to push notifications back without a separate socket.
 func (sb *serviceBuilder) UseRemote(val interface{}) ServiceBuilder {
 	remoteType := reflect.TypeOf(val)
 	if remoteType.Kind() != reflect.Struct {
@@ -56,6 +68,49 @@ func (sb *serviceBuilder) UseRemote(val interface{}) ServiceBuilder {
 	return sb
 }
 
+// RegisterSubscriber registers handler to be invoked whenever a publish
+// frame for topic arrives on any connection. handler must be a func taking
+// exactly one argument, the published message, matched by reflect against
+// the frame's payload.
+func (sb *serviceBuilder) RegisterSubscriber(topic string, handler interface{}) ServiceBuilder {
+	hv := reflect.ValueOf(handler)
+	ht := hv.Type()
+	if ht.Kind() != reflect.Func {
+		panic(fmt.Sprintf("subscriber handler for topic %q must be a func", topic))
+	}
+	if ht.NumIn() != 1 {
+		panic(fmt.Sprintf("subscriber handler for topic %q must take exactly one argument, the message", topic))
+	}
+	msgType := ht.In(0)
+
+	sb.service.subscribers[topic] = func(conn Connection, data Raw) error {
+		values, err := sb.service.codecFor(conn.GetRawConnection()).Unmarshal(data, []reflect.Type{msgType})
+		if err != nil {
+			return &RPCError{Err: "internal error", ActualErr: err}
+		}
+
+		hv.Call([]reflect.Value{reflect.ValueOf(values[0])})
+		return nil
+	}
+	return sb
+}
+
+// Use adds interceptor to the chain wrapped around every inbound API call
+// and outbound UseRemote call.
+func (sb *serviceBuilder) Use(interceptor Interceptor) ServiceBuilder {
+	sb.service.interceptors = append(sb.service.interceptors, interceptor)
+	return sb
+}
+
+// WithRegistry makes the built Service self-register as name at addr in
+// registry the first time it starts handling connections (ServeHTTP or
+// HandleConnection).
+func (sb *serviceBuilder) WithRegistry(registry Registry, name, addr string) ServiceBuilder {
+	sb.service.registry = registry
+	sb.service.registryNode = Node{ID: name + "/" + addr, Name: name, Address: addr}
+	return sb
+}
+
 func (sb *serviceBuilder) buildRemotes() {
 	for _, remoteType := range sb.remotes {
 		remoteReflectedVal := reflect.New(remoteType).Elem()
@@ -90,6 +145,25 @@ func (sb *serviceBuilder) buildRemotes() {
 			remoteReturnTypes = append(remoteReturnTypes, returnTypes)
 		}
 
+		// A remote func whose promise receives a chan return is a stream:
+		// instead of waiting for a single rpcCallReturn, the channel is fed
+		// one value per "s" frame until an "e" frame closes it.
+		streamChanIdx := make([]int, len(remoteFuncs))
+		hasCtx := make([]bool, len(remoteFuncs))
+		for i, remoteFnField := range remoteFuncs {
+			returnTypes := remoteReturnTypes[i]
+			streamChanIdx[i] = -1
+			for j, rt := range returnTypes {
+				if rt.Kind() == reflect.Chan {
+					streamChanIdx[i] = j
+					break
+				}
+			}
+
+			fnType := remoteFnField.Type
+			hasCtx[i] = fnType.NumIn() > 0 && fnType.In(0) == ctxType
+		}
+
 		service := sb.service
 		buildRemoteFn := func(conn Connection) interface{} {
 			newRemotePtr := reflect.New(remoteType)
@@ -97,8 +171,25 @@ func (sb *serviceBuilder) buildRemotes() {
 
 			for i, remoteFnField := range remoteFuncs {
 				remoteFnName := remoteFnField.Name
+				chanIdx := streamChanIdx[i]
+				returnTypes := remoteReturnTypes[i]
+				withCtx := hasCtx[i]
 				newRemote.FieldByIndex(remoteFnField.Index).Set(reflect.MakeFunc(remoteFnField.Type, func(args []reflect.Value) (results []reflect.Value) {
-					service.callRemoteFunc(conn, remoteFnName, args, remoteReturnTypes[i])
+					callArgs := args
+					var ctx context.Context
+					if withCtx {
+						ctx = args[0].Interface().(context.Context)
+						callArgs = args[1:]
+					}
+
+					switch {
+					case chanIdx != -1:
+						service.callRemoteStream(conn, remoteFnName, callArgs, returnTypes, chanIdx, returnTypes[chanIdx].Elem())
+					case withCtx:
+						service.callRemoteFuncCtx(ctx, conn, remoteFnName, callArgs, returnTypes)
+					default:
+						service.callRemoteFunc(conn, remoteFnName, callArgs, returnTypes)
+					}
 					return []reflect.Value{}
 				}))
 			}
@@ -106,6 +197,7 @@ func (sb *serviceBuilder) buildRemotes() {
 			return newRemotePtr.Interface()
 		}
 		sb.service.specialTypes[remoteType] = buildRemoteFn
+		sb.service.remoteTypes[remoteType] = true
 	}
 }
 
@@ -129,8 +221,24 @@ func (sb *serviceBuilder) buildAPI() {
 		specialInParams := make([]int, 0)
 		specialInPtrParams := make([]int, 0)
 
+		streamChanIndex := -1
+		var streamElemType reflect.Type
+
+		hasCtx := mtype.NumIn() > 1 && mtype.In(1) == ctxType
+
 		for j := 1; j < mtype.NumIn(); j++ {
 			inType := mtype.In(j)
+
+			if hasCtx && j == 1 {
+				continue
+			}
+
+			if j == mtype.NumIn()-1 && inType.Kind() == reflect.Chan && inType.ChanDir() == reflect.SendDir {
+				streamChanIndex = j
+				streamElemType = inType.Elem()
+				continue
+			}
+
 			if inType.Kind() != reflect.Ptr {
 				inParams = append(inParams, j)
 				continue
@@ -146,30 +254,42 @@ func (sb *serviceBuilder) buildAPI() {
 		}
 
 		fnName := method.Name
-		service.fnHandlers[fnName] = func(conn Connection, args []json.RawMessage) ([]interface{}, error) {
-			if len(args) != len(inParams) {
-				return nil, &RPCError{"internal error", errors.New("method input length does not match")}
+
+		if streamChanIndex != -1 {
+			service.streamHandlers[fnName] = sb.buildStreamHandler(fnName, mtype, methodValue, isLastArgError, inParams, specialInParams, specialInPtrParams, streamChanIndex, streamElemType, hasCtx)
+			continue
+		}
+
+		if hasCtx {
+			service.ctxHandlers[fnName] = sb.buildCtxHandler(fnName, mtype, methodValue, isLastArgError, inParams, specialInParams, specialInPtrParams)
+			continue
+		}
+
+		argTypes := make([]reflect.Type, len(inParams))
+		for k, j := range inParams {
+			argTypes[k] = mtype.In(j)
+		}
+
+		finalHandler := func(ctx context.Context, info CallInfo) ([]interface{}, error) {
+			values, err := service.codecFor(info.Conn.GetRawConnection()).Unmarshal(info.Args, argTypes)
+			if err != nil {
+				return nil, &RPCError{"internal error", err}
 			}
 
 			in := make([]reflect.Value, mtype.NumIn()-1)
 			for k, j := range inParams {
-				inType := mtype.In(j)
-				inValue := reflect.New(inType)
-				err := json.Unmarshal(args[k], inValue.Interface())
-				if err != nil {
-					return nil, &RPCError{"internal error", fmt.Errorf("error unmarshaling input %d: %s", k, err)}
-				}
-				in[j-1] = inValue.Elem()
+				in[j-1] = reflect.ValueOf(values[k])
 			}
 
+			special := info.Special
 			for _, j := range specialInParams {
-				inType := mtype.In(j)
-				in[j-1] = reflect.ValueOf(service.getConnValue(conn, inType.Elem()))
+				in[j-1] = reflect.ValueOf(special[0])
+				special = special[1:]
 			}
 
 			for _, j := range specialInPtrParams {
-				inType := mtype.In(j)
-				in[j-1] = reflect.ValueOf(service.getConnValue(conn, inType))
+				in[j-1] = reflect.ValueOf(special[0])
+				special = special[1:]
 			}
 
 			out := methodValue.Call(in)
@@ -193,6 +313,252 @@ func (sb *serviceBuilder) buildAPI() {
 				return outVals, nil
 			}
 		}
+
+		chained := chainInterceptors(service.interceptors, finalHandler)
+		service.fnHandlers[fnName] = func(conn Connection, args Raw) ([]interface{}, error) {
+			special := make([]interface{}, 0, len(specialInParams)+len(specialInPtrParams))
+			for _, j := range specialInParams {
+				special = append(special, service.getConnValue(conn, mtype.In(j).Elem()))
+			}
+			for _, j := range specialInPtrParams {
+				special = append(special, service.getConnValue(conn, mtype.In(j)))
+			}
+
+			return chained(context.Background(), CallInfo{Method: fnName, Conn: conn, Args: args, Special: special})
+		}
+	}
+}
+
+// buildStreamHandler wraps an API method whose last parameter is a send-only
+// channel: the channel is created per-call, the method runs in its own
+// goroutine writing to it, and every value it sends is forwarded to the
+// caller as a stream item frame until the method returns and closes it.
+//
+// Cancel (either Stream.Cancel on the client or the connection closing) only
+// guarantees that delivery stops and an rpcMessage.Kind=kindStreamEnd never
+// reaches a torn-down client; it cannot unblock the handler goroutine by
+// itself. A handler that wants to observe cancellation and return early
+// should, like a context-aware API method, take a context.Context as its
+// first parameter: buildStreamHandler registers the same activeCalls entry
+// buildCtxHandler does, so a cancel frame cancels that ctx too.
+//
+// The method invocation runs through the same interceptor chain as a plain
+// call, so auth/logging/recovery interceptors see streaming calls too.
+func (sb *serviceBuilder) buildStreamHandler(fnName string, mtype reflect.Type, methodValue reflect.Value, isLastArgError bool, inParams, specialInParams, specialInPtrParams []int, chanIndex int, elemType reflect.Type, hasCtx bool) func(conn Connection, callID string, args Raw) error {
+	service := sb.service
+
+	argTypes := make([]reflect.Type, len(inParams))
+	for k, j := range inParams {
+		argTypes[k] = mtype.In(j)
+	}
+
+	return func(conn Connection, callID string, args Raw) error {
+		codec := service.codecFor(conn.GetRawConnection())
+		values, err := codec.Unmarshal(args, argTypes)
+		if err != nil {
+			return &RPCError{Err: "internal error", ActualErr: err}
+		}
+
+		in := make([]reflect.Value, mtype.NumIn()-1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		if hasCtx {
+			in[0] = reflect.ValueOf(ctx)
+		}
+
+		for k, j := range inParams {
+			in[j-1] = reflect.ValueOf(values[k])
+		}
+
+		for _, j := range specialInParams {
+			inType := mtype.In(j)
+			in[j-1] = reflect.ValueOf(service.getConnValue(conn, inType.Elem()))
+		}
+
+		for _, j := range specialInPtrParams {
+			inType := mtype.In(j)
+			in[j-1] = reflect.ValueOf(service.getConnValue(conn, inType))
+		}
+
+		ch := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, elemType), 0)
+		in[chanIndex-1] = ch
+
+		var canceled int32
+		service.streamCancels.Store(callID, func() { atomic.StoreInt32(&canceled, 1) })
+		service.activeCalls.Store(callID, &activeCall{cancel: cancel, conn: conn})
+
+		special := make([]interface{}, 0, len(specialInParams)+len(specialInPtrParams))
+		for _, j := range specialInParams {
+			special = append(special, service.getConnValue(conn, mtype.In(j).Elem()))
+		}
+		for _, j := range specialInPtrParams {
+			special = append(special, service.getConnValue(conn, mtype.In(j)))
+		}
+
+		finalHandler := func(ctx context.Context, info CallInfo) ([]interface{}, error) {
+			out := methodValue.Call(in)
+			if isLastArgError {
+				if errOut, ok := out[len(out)-1].Interface().(error); ok && errOut != nil {
+					return nil, errOut
+				}
+			}
+			return nil, nil
+		}
+		chained := chainInterceptors(service.interceptors, finalHandler)
+
+		rawConn := conn.GetRawConnection()
+		go func() {
+			readDone := make(chan struct{})
+			go func() {
+				defer close(readDone)
+				for {
+					v, ok := ch.Recv()
+					if !ok {
+						return
+					}
+
+					if atomic.LoadInt32(&canceled) == 1 || ctx.Err() != nil {
+						continue
+					}
+
+					b, err := codec.Marshal([]interface{}{v.Interface()})
+					if err != nil {
+						continue
+					}
+					service.send(rawConn, &rpcMessage{CallID: callID, Kind: kindStreamItem, Data: Raw(b)})
+				}
+			}()
+
+			_, fnErr := chained(ctx, CallInfo{Method: fnName, Conn: conn, Args: args, Special: special})
+			<-readDone
+			stopped := atomic.LoadInt32(&canceled) == 1 || ctx.Err() != nil
+			service.streamCancels.Delete(callID)
+			service.activeCalls.Delete(callID)
+			cancel()
+			if stopped {
+				return
+			}
+
+			errString := ""
+			if fnErr != nil {
+				errString = fnErr.Error()
+			}
+			service.send(rawConn, &rpcMessage{CallID: callID, Kind: kindStreamEnd, Error: errString})
+		}()
+
+		return nil
+	}
+}
+
+// buildCtxHandler wraps an API method whose second parameter (after the
+// receiver) is a context.Context: the call runs in its own goroutine so the
+// connection's read loop keeps servicing other calls, with ctx cancelled
+// either by the call's Timeout or by an incoming cancel frame. The method
+// invocation itself runs through the same interceptor chain as a plain
+// call, so auth/logging/recovery interceptors see context-aware calls too.
+func (sb *serviceBuilder) buildCtxHandler(fnName string, mtype reflect.Type, methodValue reflect.Value, isLastArgError bool, inParams, specialInParams, specialInPtrParams []int) func(conn Connection, callID string, args Raw, timeoutMs int) error {
+	service := sb.service
+
+	argTypes := make([]reflect.Type, len(inParams))
+	for k, j := range inParams {
+		argTypes[k] = mtype.In(j)
+	}
+
+	return func(conn Connection, callID string, args Raw, timeoutMs int) error {
+		codec := service.codecFor(conn.GetRawConnection())
+		values, err := codec.Unmarshal(args, argTypes)
+		if err != nil {
+			return &RPCError{Err: "internal error", ActualErr: err}
+		}
+
+		in := make([]reflect.Value, mtype.NumIn()-1)
+
+		var ctx context.Context
+		var cancel context.CancelFunc
+		if timeoutMs > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), time.Duration(timeoutMs)*time.Millisecond)
+		} else {
+			ctx, cancel = context.WithCancel(context.Background())
+		}
+		in[0] = reflect.ValueOf(ctx)
+
+		for k, j := range inParams {
+			in[j-1] = reflect.ValueOf(values[k])
+		}
+
+		for _, j := range specialInParams {
+			inType := mtype.In(j)
+			in[j-1] = reflect.ValueOf(service.getConnValue(conn, inType.Elem()))
+		}
+
+		for _, j := range specialInPtrParams {
+			inType := mtype.In(j)
+			in[j-1] = reflect.ValueOf(service.getConnValue(conn, inType))
+		}
+
+		service.activeCalls.Store(callID, &activeCall{cancel: cancel, conn: conn})
+		rawConn := conn.GetRawConnection()
+
+		special := make([]interface{}, 0, len(specialInParams)+len(specialInPtrParams))
+		for _, j := range specialInParams {
+			special = append(special, service.getConnValue(conn, mtype.In(j).Elem()))
+		}
+		for _, j := range specialInPtrParams {
+			special = append(special, service.getConnValue(conn, mtype.In(j)))
+		}
+
+		finalHandler := func(ctx context.Context, info CallInfo) ([]interface{}, error) {
+			out := methodValue.Call(in)
+			if isLastArgError {
+				outVals := make([]interface{}, len(out)-1)
+				for j := 0; j < len(out)-1; j++ {
+					outVals[j] = out[j].Interface()
+				}
+
+				errOut := out[len(out)-1].Interface()
+				if err, ok := errOut.(error); ok || errOut == nil {
+					return outVals, err
+				}
+				panic(fmt.Sprintf("last return is not of type error in function %s, got %s", fnName, out[len(out)-1].Type())) // should never happen!
+			}
+
+			outVals := make([]interface{}, len(out))
+			for j := range out {
+				outVals[j] = out[j].Interface()
+			}
+			return outVals, nil
+		}
+		chained := chainInterceptors(service.interceptors, finalHandler)
+
+		run := func() {
+			outVals, fnErr := chained(ctx, CallInfo{Method: fnName, Conn: conn, Args: args, Special: special})
+			service.activeCalls.Delete(callID)
+			cancel()
+
+			errString := ""
+			var data Raw
+			if fnErr != nil {
+				errString = fnErr.Error()
+			} else if len(outVals) > 0 {
+				if b, merr := codec.Marshal(outVals); merr == nil {
+					data = Raw(b)
+				}
+			}
+
+			service.send(rawConn, &rpcCallReturn{CallID: callID, Error: errString, Data: data})
+		}
+
+		if isHTTPConn(conn) {
+			// ServeHTTP returns as soon as this handler does, and the
+			// one-shot httpConn can't be written to afterwards, so there is
+			// no connection left to deliver an async result on; block here
+			// instead of handing off to a goroutine.
+			run()
+		} else {
+			go run()
+		}
+
+		return nil
 	}
 }
 
@@ -0,0 +1,103 @@
+package autorpc
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+)
+
+var anyType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// Client calls autorpc services discovered by logical name through a
+// Registry, dialing nodes on demand and reusing the same callRemoteFunc
+// machinery a typed UseRemote proxy would.
+//
+// Call only supports a single return value (besides the trailing error): it
+// has no struct describing the call's return shape, so it decodes the
+// response into interface{}. Use NewServiceBuilder/UseRemote for typed,
+// multi-value calls.
+type Client struct {
+	service  *service
+	registry Registry
+	conns    sync.Map // node address -> Connection
+}
+
+// NewClient returns a Client that looks up nodes in registry.
+func NewClient(registry Registry) *Client {
+	return &Client{
+		service:  newService(reflect.ValueOf(new(struct{}))),
+		registry: registry,
+	}
+}
+
+func (c *Client) connFor(node Node) (Connection, error) {
+	if v, ok := c.conns.Load(node.Address); ok {
+		return v.(Connection), nil
+	}
+
+	netConn, err := net.Dial("tcp", node.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &connection{service: c.service, conn: netConn, handling: true}
+
+	// HandleConnection negotiates the codec handshake on netConn before
+	// serving calls; block until that negotiation completes so Call never
+	// writes an rpcCall frame onto the socket while the handshake reader on
+	// either side is still mid-exchange.
+	ready := make(chan struct{})
+	go c.service.HandleConnection(netConn, func(Connection) {
+		close(ready)
+	})
+	<-ready
+
+	c.conns.Store(node.Address, conn)
+
+	return conn, nil
+}
+
+// Call looks up a healthy node for name in the Client's Registry, dials it
+// if not already connected, and invokes fn with args, blocking until the
+// response arrives.
+func (c *Client) Call(name, fn string, args ...interface{}) (interface{}, error) {
+	nodes, err := c.registry.GetService(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("autorpc: no nodes registered for service %q", name)
+	}
+
+	conn, err := c.connFor(nodes[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var result interface{}
+	var callErr error
+	done := make(chan struct{})
+
+	promiseFunc := reflect.MakeFunc(reflect.FuncOf([]reflect.Type{anyType, errorType}, nil, false), func(in []reflect.Value) []reflect.Value {
+		if !in[0].IsNil() {
+			result = in[0].Interface()
+		}
+		if e, ok := in[1].Interface().(error); ok && e != nil {
+			callErr = e
+		}
+		close(done)
+		return nil
+	})
+
+	callArgs := make([]reflect.Value, len(args)+1)
+	for i, a := range args {
+		callArgs[i] = reflect.ValueOf(a)
+	}
+	callArgs[len(args)] = promiseFunc
+
+	c.service.callRemoteFunc(conn, fn, callArgs, []reflect.Type{anyType})
+	<-done
+
+	return result, callErr
+}
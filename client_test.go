@@ -0,0 +1,52 @@
+package autorpc
+
+import (
+	"net"
+	"testing"
+)
+
+type echoTestAPI struct{}
+
+func (*echoTestAPI) Echo(s string) (string, error) {
+	return s, nil
+}
+
+// TestClientCallDialsAndCalls exercises connFor's dial path end-to-end: a
+// real listener accepting HandleConnection, and a Client dialing it through
+// a Registry. This is the path the review flagged as racing the codec
+// handshake against the first rpcCall frame; connFor must not hand the
+// connection to Call until HandleConnection's negotiation has completed.
+func TestClientCallDialsAndCalls(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	svc := NewServiceBuilder(&echoTestAPI{}).Build()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go svc.HandleConnection(conn, nil)
+		}
+	}()
+
+	registry := NewMemoryRegistry()
+	if err := registry.Register(Node{ID: "1", Name: "echo", Address: ln.Addr().String()}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	client := NewClient(registry)
+	for i := 0; i < 10; i++ {
+		result, err := client.Call("echo", "Echo", "hello")
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		if result != "hello" {
+			t.Fatalf("call %d: got %v, want %q", i, result, "hello")
+		}
+	}
+}
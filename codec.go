@@ -0,0 +1,99 @@
+package autorpc
+
+import (
+	"io"
+	"mime"
+	"reflect"
+)
+
+// Codec decouples the wire format used for call arguments and return values
+// from the reflection machinery in builder.go/service.go, so a service can
+// trade the default JSON encoding for something smaller or faster without
+// any change to how methods or remotes are declared.
+type Codec interface {
+	// Name identifies the codec for content-type negotiation and the
+	// connection handshake (e.g. "json", "msgpack", "protobuf").
+	Name() string
+	// Marshal encodes a slice of values (call args or return values, in
+	// order) into a single wire-format payload.
+	Marshal(values []interface{}) ([]byte, error)
+	// Unmarshal decodes a payload produced by Marshal back into values of
+	// the given types, in the same order.
+	Unmarshal(data []byte, types []reflect.Type) ([]interface{}, error)
+	// NewEncoder/NewDecoder back the framed rpcMessage/rpcCall stream for
+	// connection-oriented transports.
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+// Encoder writes one frame (an rpcCall, rpcMessage or rpcCallReturn) to the
+// underlying stream.
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Decoder reads one frame from the underlying stream.
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// Raw is an undecoded payload produced by a Codec's Marshal. It is kept
+// opaque as it travels inside rpcCall/rpcMessage so the envelope codec never
+// needs to understand the argument codec's format.
+type Raw []byte
+
+// MarshalJSON makes Raw splice verbatim into a JSON envelope, mirroring
+// encoding/json.RawMessage.
+func (r Raw) MarshalJSON() ([]byte, error) {
+	if r == nil {
+		return []byte("null"), nil
+	}
+	return r, nil
+}
+
+// UnmarshalJSON captures the raw JSON text for later decoding by a Codec.
+func (r *Raw) UnmarshalJSON(data []byte) error {
+	*r = append((*r)[0:0], data...)
+	return nil
+}
+
+// builtinCodecs are the codecs available for negotiation regardless of the
+// ServiceBuilder's configured default; WithCodec only changes what is used
+// when negotiation doesn't pick something else.
+var builtinCodecs = map[string]func() Codec{
+	"json":     func() Codec { return &jsonCodec{} },
+	"msgpack":  func() Codec { return &msgpackCodec{} },
+	"protobuf": func() Codec { return &protobufCodec{} },
+}
+
+func codecByName(name string) (Codec, bool) {
+	newCodec, ok := builtinCodecs[name]
+	if !ok {
+		return nil, false
+	}
+	return newCodec(), true
+}
+
+// contentTypeCodecName maps a Content-Type/Accept header value to a builtin
+// codec name, or "" if it doesn't name one we know.
+func contentTypeCodecName(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		mediaType = header
+	}
+
+	switch mediaType {
+	case "application/json":
+		return "json"
+	case "application/msgpack", "application/x-msgpack":
+		return "msgpack"
+	case "application/protobuf", "application/x-protobuf":
+		return "protobuf"
+	default:
+		return ""
+	}
+}
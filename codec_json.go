@@ -0,0 +1,51 @@
+package autorpc
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+)
+
+// jsonCodec is the default Codec and preserves autorpc's original wire
+// format exactly.
+type jsonCodec struct{}
+
+func (*jsonCodec) Name() string {
+	return "json"
+}
+
+func (*jsonCodec) Marshal(values []interface{}) ([]byte, error) {
+	return json.Marshal(values)
+}
+
+func (*jsonCodec) Unmarshal(data []byte, types []reflect.Type) ([]interface{}, error) {
+	if len(data) == 0 || string(data) == "null" {
+		data = []byte("[]")
+	}
+
+	raw := make([]json.RawMessage, 0, len(types))
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw) != len(types) {
+		return nil, &RPCError{Err: "got wrong num of values"}
+	}
+
+	values := make([]interface{}, len(types))
+	for i, t := range types {
+		v := reflect.New(t)
+		if err := json.Unmarshal(raw[i], v.Interface()); err != nil {
+			return nil, err
+		}
+		values[i] = v.Elem().Interface()
+	}
+	return values, nil
+}
+
+func (*jsonCodec) NewEncoder(w io.Writer) Encoder {
+	return json.NewEncoder(w)
+}
+
+func (*jsonCodec) NewDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
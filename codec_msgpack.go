@@ -0,0 +1,61 @@
+package autorpc
+
+import (
+	"io"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpackCodec is a smaller/faster drop-in replacement for jsonCodec. It
+// reuses the existing `json` struct tags on rpcCall/rpcMessage so the
+// envelope shape doesn't need a second set of tags maintained in parallel.
+type msgpackCodec struct{}
+
+func (*msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (*msgpackCodec) Marshal(values []interface{}) ([]byte, error) {
+	return msgpack.Marshal(values)
+}
+
+func (*msgpackCodec) Unmarshal(data []byte, types []reflect.Type) ([]interface{}, error) {
+	var raw []msgpack.RawMessage
+	if len(data) > 0 {
+		if err := msgpack.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+	}
+	if len(raw) != len(types) {
+		return nil, &RPCError{Err: "got wrong num of values"}
+	}
+
+	values := make([]interface{}, len(types))
+	for i, t := range types {
+		v := reflect.New(t)
+		if err := msgpack.Unmarshal(raw[i], v.Interface()); err != nil {
+			return nil, err
+		}
+		values[i] = v.Elem().Interface()
+	}
+	return values, nil
+}
+
+func (*msgpackCodec) newEncoder() *msgpack.Encoder {
+	enc := msgpack.NewEncoder(nil)
+	enc.SetCustomStructTag("json")
+	return enc
+}
+
+func (c *msgpackCodec) NewEncoder(w io.Writer) Encoder {
+	enc := c.newEncoder()
+	enc.Reset(w)
+	return enc
+}
+
+func (*msgpackCodec) NewDecoder(r io.Reader) Decoder {
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag("json")
+	return dec
+}
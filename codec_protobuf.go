@@ -0,0 +1,99 @@
+package autorpc
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// protobufCodec marshals call arguments/returns as length-prefixed protobuf
+// messages. Unlike JSON/MessagePack, protobuf has no generic encoding for
+// arbitrary Go values, so every value passed over a protobuf-coded call must
+// implement proto.Message.
+type protobufCodec struct{}
+
+func (*protobufCodec) Name() string {
+	return "protobuf"
+}
+
+// Marshal concatenates each value's length-prefixed protobuf encoding, then
+// base64-encodes and JSON-quotes the result so it splices into the JSON
+// envelope (see NewEncoder) as a valid string rather than raw binary.
+func (*protobufCodec) Marshal(values []interface{}) ([]byte, error) {
+	var out []byte
+	for _, v := range values {
+		msg, ok := v.(proto.Message)
+		if !ok {
+			return nil, fmt.Errorf("autorpc: protobuf codec requires proto.Message, got %T", v)
+		}
+
+		b, err := proto.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		var lenBuf [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(lenBuf[:], uint64(len(b)))
+		out = append(out, lenBuf[:n]...)
+		out = append(out, b...)
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(out))
+}
+
+func (*protobufCodec) Unmarshal(data []byte, types []reflect.Type) ([]interface{}, error) {
+	var encoded string
+	if len(data) > 0 && string(data) != "null" {
+		if err := json.Unmarshal(data, &encoded); err != nil {
+			return nil, fmt.Errorf("autorpc: protobuf codec: %w", err)
+		}
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("autorpc: protobuf codec: %w", err)
+	}
+
+	messageType := reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+	values := make([]interface{}, len(types))
+	for i, t := range types {
+		if !reflect.PtrTo(t).Implements(messageType) {
+			return nil, fmt.Errorf("autorpc: protobuf codec requires proto.Message, got %s", t)
+		}
+
+		n, read := binary.Uvarint(raw)
+		if read <= 0 {
+			return nil, fmt.Errorf("autorpc: protobuf codec: malformed length prefix for value %d", i)
+		}
+		raw = raw[read:]
+		if uint64(len(raw)) < n {
+			return nil, fmt.Errorf("autorpc: protobuf codec: truncated value %d", i)
+		}
+
+		v := reflect.New(t)
+		if err := proto.Unmarshal(raw[:n], v.Interface().(proto.Message)); err != nil {
+			return nil, err
+		}
+		values[i] = v.Elem().Interface()
+		raw = raw[n:]
+	}
+	return values, nil
+}
+
+// NewEncoder/NewDecoder frame rpcCall/rpcMessage/rpcCallReturn, none of which
+// are proto.Message themselves. Control frames therefore fall back to JSON
+// internally even when the negotiated payload codec is protobuf; the Raw
+// argument/return payloads inside them are protobuf-encoded but, thanks to
+// Marshal's base64/JSON-string framing above, still splice into that JSON
+// envelope as valid text.
+func (*protobufCodec) NewEncoder(w io.Writer) Encoder {
+	return (&jsonCodec{}).NewEncoder(w)
+}
+
+func (*protobufCodec) NewDecoder(r io.Reader) Decoder {
+	return (&jsonCodec{}).NewDecoder(r)
+}
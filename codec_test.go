@@ -0,0 +1,89 @@
+package autorpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// roundTrip marshals values with codec, then unmarshals the result back
+// using types, asserting the number of decoded values matches; callers
+// check the decoded values themselves.
+func roundTrip(t *testing.T, codec Codec, values []interface{}, types []reflect.Type) []interface{} {
+	t.Helper()
+
+	data, err := codec.Marshal(values)
+	if err != nil {
+		t.Fatalf("%s Marshal: %v", codec.Name(), err)
+	}
+
+	got, err := codec.Unmarshal(data, types)
+	if err != nil {
+		t.Fatalf("%s Unmarshal: %v", codec.Name(), err)
+	}
+	if len(got) != len(values) {
+		t.Fatalf("%s: got %d values, want %d", codec.Name(), len(got), len(values))
+	}
+	return got
+}
+
+func TestJSONCodecRoundTrip(t *testing.T) {
+	codec := &jsonCodec{}
+	got := roundTrip(t, codec, []interface{}{"hello", 42}, []reflect.Type{reflect.TypeOf(""), reflect.TypeOf(0)})
+	if got[0] != "hello" || got[1] != 42 {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestMsgpackCodecRoundTrip(t *testing.T) {
+	codec := &msgpackCodec{}
+	got := roundTrip(t, codec, []interface{}{"hello", 42}, []reflect.Type{reflect.TypeOf(""), reflect.TypeOf(0)})
+	if got[0] != "hello" || got[1] != 42 {
+		t.Fatalf("got %v", got)
+	}
+}
+
+// TestProtobufCodecRoundTrip checks that a proto.Message survives the
+// protobuf codec's Marshal followed by Unmarshal.
+func TestProtobufCodecRoundTrip(t *testing.T) {
+	codec := &protobufCodec{}
+	wrapperType := reflect.TypeOf(wrapperspb.Int32Value{})
+
+	got := roundTrip(t, codec, []interface{}{&wrapperspb.Int32Value{Value: 42}}, []reflect.Type{wrapperType})
+	if reflect.ValueOf(got[0]).FieldByName("Value").Int() != 42 {
+		t.Fatalf("got %v, want 42", got[0])
+	}
+}
+
+// TestProtobufCodecEnvelopeRoundTrip checks that Marshal's output splices
+// into the JSON envelope (via Raw) as valid text, not raw protobuf bytes,
+// since NewEncoder/NewDecoder fall back to JSON.
+func TestProtobufCodecEnvelopeRoundTrip(t *testing.T) {
+	codec := &protobufCodec{}
+
+	raw, err := codec.Marshal([]interface{}{&wrapperspb.Int32Value{Value: 42}})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	call := &rpcCall{CallID: "1", FuncName: "Foo", Args: Raw(raw)}
+	encoded, err := json.Marshal(call)
+	if err != nil {
+		t.Fatalf("encoding call into envelope: %v", err)
+	}
+
+	var decoded rpcCall
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("decoding call from envelope: %v", err)
+	}
+
+	values, err := codec.Unmarshal(decoded.Args, []reflect.Type{reflect.TypeOf(wrapperspb.Int32Value{})})
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if reflect.ValueOf(values[0]).FieldByName("Value").Int() != 42 {
+		t.Fatalf("got %v", values[0])
+	}
+}
@@ -0,0 +1,92 @@
+package autorpc
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+var ctxType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// activeCall tracks an in-flight, context-aware API method invocation so it
+// can be aborted by a cancel frame from the client or by the connection
+// closing.
+type activeCall struct {
+	cancel context.CancelFunc
+	conn   Connection
+}
+
+// cancelCallsForConn aborts every activeCall and stream belonging to conn;
+// called when the connection is closing (StopHandling, EOF in handle).
+func (service *service) cancelCallsForConn(conn Connection) {
+	service.activeCalls.Range(func(key, value interface{}) bool {
+		call := value.(*activeCall)
+		if call.conn == conn {
+			call.cancel()
+			service.activeCalls.Delete(key)
+		}
+		return true
+	})
+}
+
+// callRemoteFuncCtx is callRemoteFunc plus context propagation: ctx's
+// deadline (if any) is sent to the server as the call's timeout, and
+// cancelling ctx sends a cancel frame and rejects the local promise. The
+// send itself runs through the outbound interceptor chain, same as a plain
+// callRemoteFunc.
+func (service *service) callRemoteFuncCtx(ctx context.Context, conn Connection, fn string, args []reflect.Value, returnTypes []reflect.Type) {
+	nArgs := len(args) - 1
+	codec := service.codecFor(conn.GetRawConnection())
+	promise := &remotePromise{
+		conn:        conn,
+		codec:       codec,
+		returnTypes: returnTypes,
+		promiseFunc: args[nArgs],
+		done:        make(chan struct{}),
+	}
+
+	argVals := make([]interface{}, nArgs)
+	for j := 0; j < nArgs; j++ {
+		argVals[j] = args[j].Interface()
+	}
+
+	raw, err := codec.Marshal(argVals)
+	if err != nil {
+		promise.reject(err)
+		return
+	}
+
+	var callID string
+	sendHandler := func(callCtx context.Context, info CallInfo) ([]interface{}, error) {
+		callID = service.newCall(promise)
+		call := rpcCall{CallID: callID, Args: info.Args, FuncName: info.Method}
+		if deadline, ok := ctx.Deadline(); ok {
+			call.Timeout = int(time.Until(deadline) / time.Millisecond)
+		}
+
+		if err := service.send(conn.GetRawConnection(), &call); err != nil {
+			service.pendingCalls.Delete(callID)
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	chained := chainInterceptors(service.interceptors, sendHandler)
+	if _, err := chained(ctx, CallInfo{Method: fn, Conn: conn, Args: Raw(raw)}); err != nil {
+		promise.reject(err)
+		return
+	}
+
+	go func() {
+		select {
+		case <-promise.done:
+			// Call already settled (resolved or rejected) via the normal
+			// response path; nothing left to cancel.
+		case <-ctx.Done():
+			if _, exists := service.pendingCalls.LoadAndDelete(callID); exists {
+				service.send(conn.GetRawConnection(), &rpcMessage{CallID: callID, Kind: kindStreamCancel})
+				promise.reject(ctx.Err())
+			}
+		}
+	}()
+}
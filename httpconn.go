@@ -29,6 +29,17 @@ func newHTTPConn(w http.ResponseWriter, r *http.Request) net.Conn {
 	}
 }
 
+// isHTTPConn reports whether conn's transport is a single-shot ServeHTTP
+// request/response rather than a long-lived HandleConnection socket. Handlers
+// that would otherwise deliver their result asynchronously (ctx-aware calls)
+// or as a series of frames over time (streams) need to know this: ServeHTTP
+// returns as soon as the dispatching handler does, and nothing can be
+// written to conn afterwards.
+func isHTTPConn(conn Connection) bool {
+	_, ok := conn.GetRawConnection().(*httpConn)
+	return ok
+}
+
 func (conn *httpConn) Read(b []byte) (n int, err error) {
 	return conn.r.Body.Read(b)
 }
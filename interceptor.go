@@ -0,0 +1,40 @@
+package autorpc
+
+import "context"
+
+// CallInfo describes a single inbound or outbound call to an Interceptor: the
+// method name, its raw wire arguments, the Connection it travels over, and
+// the connection's resolved special-type values the target method also
+// receives. Special lists the values for parameters whose element type is a
+// special type first, then those for parameters whose pointer type is one,
+// each group in declaration order; it is empty for outbound calls.
+type CallInfo struct {
+	Method  string
+	Conn    Connection
+	Args    Raw
+	Special []interface{}
+}
+
+// Handler performs a single call given its CallInfo and returns its raw
+// result values, or an error.
+type Handler func(ctx context.Context, info CallInfo) ([]interface{}, error)
+
+// Interceptor wraps a Handler, letting it run code before and/or after the
+// call, short-circuit it, or adapt its result or error. Interceptors compose
+// in registration order: the first one registered with Use sees the call
+// first and runs outermost.
+type Interceptor func(ctx context.Context, info CallInfo, next Handler) ([]interface{}, error)
+
+// chainInterceptors builds the Handler that runs final wrapped by every
+// interceptor in order, outermost first.
+func chainInterceptors(interceptors []Interceptor, final Handler) Handler {
+	h := final
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor := interceptors[i]
+		next := h
+		h = func(ctx context.Context, info CallInfo) ([]interface{}, error) {
+			return interceptor(ctx, info, next)
+		}
+	}
+	return h
+}
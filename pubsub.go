@@ -0,0 +1,35 @@
+package autorpc
+
+// handlePublishFrame routes an incoming publish frame to the subscriber
+// handler registered for its topic, if any. A topic with no registered
+// subscriber is silently dropped, the same way an unrecognized response
+// CallID is.
+func (service *service) handlePublishFrame(conn Connection, msg *rpcMessage) error {
+	sub, ok := service.subscribers[msg.Topic]
+	if !ok {
+		return nil
+	}
+	return sub(conn, msg.Data)
+}
+
+// publish marshals msg with conn's negotiated codec and sends it to conn's
+// peer as a publish frame for topic.
+func (service *service) publish(conn Connection, topic string, msg interface{}) error {
+	codec := service.codecFor(conn.GetRawConnection())
+	raw, err := codec.Marshal([]interface{}{msg})
+	if err != nil {
+		return err
+	}
+
+	return service.send(conn.GetRawConnection(), &rpcMessage{Topic: topic, Kind: kindPublish, Data: Raw(raw)})
+}
+
+// Broadcast publishes msg on topic to every connection currently being
+// handled by the service. Per-connection send errors are not reported back,
+// the same way a single slow or gone peer doesn't fail a multicast.
+func (service *service) Broadcast(topic string, msg interface{}) {
+	service.conns.Range(func(_, value interface{}) bool {
+		value.(Connection).Publish(topic, msg)
+		return true
+	})
+}
@@ -0,0 +1,136 @@
+package autorpc
+
+import (
+	"errors"
+	"sync"
+)
+
+// Node describes one instance of a registered service: a logical name and
+// the network address a Client should dial to reach it.
+type Node struct {
+	ID      string
+	Name    string
+	Address string
+}
+
+// Watcher streams Node changes for a service name watched through
+// Registry.Watch, until Stop is called.
+type Watcher interface {
+	// Next blocks until the watched service's node list changes, returning
+	// the new list.
+	Next() ([]Node, error)
+	Stop()
+}
+
+// Registry discovers and advertises autorpc service nodes, following the
+// go-micro registry model. Implementations must be safe for concurrent use.
+type Registry interface {
+	Register(node Node) error
+	Deregister(node Node) error
+	Watch(service string) (Watcher, error)
+	GetService(name string) ([]Node, error)
+}
+
+// NewMemoryRegistry returns a Registry that keeps nodes in memory, useful for
+// tests and single-process multi-service setups.
+func NewMemoryRegistry() Registry {
+	return &memoryRegistry{
+		services: make(map[string][]Node),
+		watchers: make(map[string][]*memoryWatcher),
+	}
+}
+
+type memoryRegistry struct {
+	mu       sync.Mutex
+	services map[string][]Node
+	watchers map[string][]*memoryWatcher
+}
+
+func (r *memoryRegistry) Register(node Node) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	nodes := r.services[node.Name]
+	for i, n := range nodes {
+		if n.ID == node.ID {
+			nodes[i] = node
+			r.notifyLocked(node.Name, nodes)
+			return nil
+		}
+	}
+
+	nodes = append(nodes, node)
+	r.services[node.Name] = nodes
+	r.notifyLocked(node.Name, nodes)
+	return nil
+}
+
+func (r *memoryRegistry) Deregister(node Node) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	nodes := r.services[node.Name]
+	for i, n := range nodes {
+		if n.ID == node.ID {
+			nodes = append(nodes[:i], nodes[i+1:]...)
+			r.services[node.Name] = nodes
+			r.notifyLocked(node.Name, nodes)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *memoryRegistry) GetService(name string) ([]Node, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	nodes := make([]Node, len(r.services[name]))
+	copy(nodes, r.services[name])
+	return nodes, nil
+}
+
+func (r *memoryRegistry) Watch(service string) (Watcher, error) {
+	w := &memoryWatcher{ch: make(chan []Node, 1), stop: make(chan struct{})}
+
+	r.mu.Lock()
+	r.watchers[service] = append(r.watchers[service], w)
+	r.mu.Unlock()
+
+	return w, nil
+}
+
+// notifyLocked must be called with r.mu held.
+func (r *memoryRegistry) notifyLocked(service string, nodes []Node) {
+	snapshot := make([]Node, len(nodes))
+	copy(snapshot, nodes)
+
+	for _, w := range r.watchers[service] {
+		// Replace any snapshot Next has not taken yet, so Next always
+		// returns the latest list.
+		select {
+		case <-w.ch:
+		default:
+		}
+		w.ch <- snapshot
+	}
+}
+
+type memoryWatcher struct {
+	ch       chan []Node
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (w *memoryWatcher) Next() ([]Node, error) {
+	select {
+	case nodes := <-w.ch:
+		return nodes, nil
+	case <-w.stop:
+		return nil, errors.New("autorpc: watcher stopped")
+	}
+}
+
+func (w *memoryWatcher) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+}
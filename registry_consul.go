@@ -0,0 +1,124 @@
+package autorpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// NewConsulRegistry returns a Registry backed by a Consul agent's HTTP API at
+// addr (e.g. "http://127.0.0.1:8500"). It supports Register, Deregister and
+// GetService (via the health/passing endpoint); Watch is not supported since
+// long-poll blocking queries aren't implemented here, and callers should poll
+// GetService instead.
+func NewConsulRegistry(addr string) Registry {
+	return &consulRegistry{addr: strings.TrimRight(addr, "/"), http: http.DefaultClient}
+}
+
+type consulRegistry struct {
+	addr string
+	http *http.Client
+}
+
+type consulServiceRegistration struct {
+	ID      string `json:"ID"`
+	Name    string `json:"Name"`
+	Address string `json:"Address"`
+	Port    int    `json:"Port"`
+}
+
+type consulHealthEntry struct {
+	Service struct {
+		ID      string `json:"ID"`
+		Service string `json:"Service"`
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+	} `json:"Service"`
+}
+
+func (r *consulRegistry) Register(node Node) error {
+	host, portStr, err := net.SplitHostPort(node.Address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(&consulServiceRegistration{ID: node.ID, Name: node.Name, Address: host, Port: port})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, r.addr+"/v1/agent/service/register", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("autorpc: consul register failed: %s", resp.Status)
+	}
+	return nil
+}
+
+func (r *consulRegistry) Deregister(node Node) error {
+	req, err := http.NewRequest(http.MethodPut, r.addr+"/v1/agent/service/deregister/"+node.ID, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("autorpc: consul deregister failed: %s", resp.Status)
+	}
+	return nil
+}
+
+func (r *consulRegistry) GetService(name string) ([]Node, error) {
+	resp, err := r.http.Get(r.addr + "/v1/health/service/" + name + "?passing=true")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("autorpc: consul lookup failed: %s", resp.Status)
+	}
+
+	var entries []consulHealthEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+
+	nodes := make([]Node, len(entries))
+	for i, e := range entries {
+		nodes[i] = Node{
+			ID:      e.Service.ID,
+			Name:    e.Service.Service,
+			Address: net.JoinHostPort(e.Service.Address, strconv.Itoa(e.Service.Port)),
+		}
+	}
+	return nodes, nil
+}
+
+func (r *consulRegistry) Watch(service string) (Watcher, error) {
+	return nil, errors.New("autorpc: consul registry does not support Watch, poll GetService instead")
+}
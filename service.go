@@ -1,6 +1,7 @@
 package autorpc
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,23 +18,52 @@ import (
 )
 
 type rpcCall struct {
-	CallID   string            `json:"c"`
-	Args     []json.RawMessage `json:"a"`
-	FuncName string            `json:"f"`
+	CallID   string `json:"c"`
+	Args     Raw    `json:"a"`
+	FuncName string `json:"f"`
+	// Timeout is an optional per-call deadline, in milliseconds, derived
+	// from the caller's context.Context deadline (if any).
+	Timeout int `json:"t,omitempty"`
 }
 
 type rpcCallReturn struct {
-	CallID string        `json:"c"`
-	Error  string        `json:"e,omitempty"`
-	Data   []interface{} `json:"d,omitempty"`
+	CallID string `json:"c"`
+	Error  string `json:"e,omitempty"`
+	Data   Raw    `json:"d,omitempty"`
 }
 
 type rpcMessage struct {
-	CallID   string            `json:"c"`
-	FuncName string            `json:"f,omitempty"`
-	Args     []json.RawMessage `json:"a,omitempty"`
-	Error    string            `json:"e,omitempty"`
-	Data     []json.RawMessage `json:"d,omitempty"`
+	CallID   string `json:"c"`
+	FuncName string `json:"f,omitempty"`
+	Args     Raw    `json:"a,omitempty"`
+	Error    string `json:"e,omitempty"`
+	Data     Raw    `json:"d,omitempty"`
+	Kind     string `json:"k,omitempty"`
+	Timeout  int    `json:"t,omitempty"`
+	// Topic is set on publish frames (Kind == kindPublish) to the topic the
+	// Data payload was published on.
+	Topic string `json:"p,omitempty"`
+}
+
+// Frame kinds used to multiplex streaming calls and publish/subscribe
+// messages over the same connection as regular request/response calls. The
+// zero value keeps the existing call and response framing untouched.
+const (
+	kindStreamItem   = "s"
+	kindStreamEnd    = "e"
+	kindStreamCancel = "x"
+	kindPublish      = "p"
+)
+
+// codecHandshake is always exchanged as the very first frame on a
+// HandleConnection connection, in plain JSON regardless of the negotiated
+// codec, so each side can bootstrap the other's choice of Codec.
+type codecHandshake struct {
+	Codec string `json:"codec,omitempty"`
+}
+
+func (msg *rpcMessage) isStream() bool {
+	return msg.Kind != ""
 }
 
 func (msg *rpcMessage) isCall() bool {
@@ -50,31 +80,49 @@ func (msg *rpcMessage) isRPCError() bool {
 
 type remotePromise struct {
 	conn        Connection
+	codec       Codec
 	returnTypes []reflect.Type
 	promiseFunc reflect.Value
+
+	// done is closed exactly once, by whichever of resolve/reject settles
+	// the call first. callRemoteFuncCtx selects on it so its ctx-cancellation
+	// watcher goroutine can exit as soon as the call completes instead of
+	// only waking on ctx.Done(), which never fires for calls made with
+	// context.Background() and otherwise leaks a goroutine per call until
+	// the deadline.
+	done     chan struct{}
+	doneOnce sync.Once
 }
 
-func (promise *remotePromise) resolve(data []json.RawMessage) error {
-	numReturns := len(promise.returnTypes)
-	if len(data) != numReturns {
-		return &RPCError{Err: "got wrong num of returns"}
+func (promise *remotePromise) settle() {
+	promise.doneOnce.Do(func() {
+		if promise.done != nil {
+			close(promise.done)
+		}
+	})
+}
+
+func (promise *remotePromise) resolve(data Raw) error {
+	defer promise.settle()
+
+	values, err := promise.codec.Unmarshal(data, promise.returnTypes)
+	if err != nil {
+		return &RPCError{Err: "internal error", ActualErr: err}
 	}
 
+	numReturns := len(promise.returnTypes)
 	returns := make([]reflect.Value, numReturns+1)
-	for j, returnType := range promise.returnTypes {
-		returnValue := reflect.New(returnType)
-		err := json.Unmarshal(data[j], returnValue.Interface())
-		if err != nil {
-			return &RPCError{Err: fmt.Sprintf("error unmarshaling input %d: %s", j, err)}
-		}
-		returns[j] = returnValue.Elem()
+	for j, v := range values {
+		returns[j] = reflect.ValueOf(v)
 	}
-	returns[numReturns] = reflect.New(reflect.TypeOf((*error)(nil)).Elem()).Elem()
+	returns[numReturns] = reflect.Zero(errorType)
 	promise.promiseFunc.Call(returns)
 	return nil
 }
 
 func (promise *remotePromise) reject(err error) {
+	defer promise.settle()
+
 	numReturns := len(promise.returnTypes)
 	returns := make([]reflect.Value, numReturns+1)
 	for j, returnType := range promise.returnTypes {
@@ -126,20 +174,70 @@ func (conn *connection) AssignValue(val interface{}) error {
 
 func (conn *connection) StopHandling() {
 	conn.handling = false
+	conn.service.cancelCallsForConn(conn)
+}
+
+func (conn *connection) Publish(topic string, msg interface{}) error {
+	return conn.service.publish(conn, topic, msg)
+}
+
+// Remote returns this connection's instance of the reflected remote proxy
+// built for val's type by UseRemote, letting either peer call back into
+// whatever API the other side exposed over the same connection (e.g. a
+// server pushing progress updates to a specific connected client).
+func (conn *connection) Remote(val interface{}) (interface{}, error) {
+	t := reflect.TypeOf(val)
+	service := conn.service
+	if !service.remoteTypes[t] {
+		return nil, fmt.Errorf("type %s was not registered with UseRemote", t.String())
+	}
+
+	return service.getConnValue(conn, t), nil
 }
 
 type service struct {
-	wsUpgrader   websocket.Upgrader
-	apiPtr       reflect.Value
-	specialTypes map[reflect.Type]func(Connection) interface{}
-	fnHandlers   map[string]func(conn Connection, args []json.RawMessage) ([]interface{}, error)
-	connValues   sync.Map
-	connDecoders sync.Map
-	pendingCalls sync.Map
+	wsUpgrader      websocket.Upgrader
+	apiPtr          reflect.Value
+	codec           Codec
+	specialTypes    map[reflect.Type]func(Connection) interface{}
+	fnHandlers      map[string]func(conn Connection, args Raw) ([]interface{}, error)
+	streamHandlers  map[string]func(conn Connection, callID string, args Raw) error
+	ctxHandlers     map[string]func(conn Connection, callID string, args Raw, timeoutMs int) error
+	connValues      sync.Map
+	connDecoders    sync.Map
+	connCodecs      sync.Map // net.Conn -> Codec, negotiated per connection
+	connReaders     sync.Map // net.Conn -> io.Reader, set when negotiation consumes a handshake frame
+	pendingCalls    sync.Map
+	streamConsumers sync.Map // callID -> *streamConsumer, client side of a stream
+	streamCancels   sync.Map // callID -> func(), server side of a stream
+	activeCalls     sync.Map // callID -> *activeCall, in-flight context-aware API calls
+	subscribers     map[string]func(conn Connection, data Raw) error
+	conns           sync.Map // net.Conn -> Connection, live connections eligible for Broadcast
+	interceptors    []Interceptor
+	registry        Registry
+	registryNode    Node
+	registerOnce    sync.Once
+	remoteTypes     map[reflect.Type]bool // types registered via UseRemote, for Connection.Remote
+}
+
+// ensureRegistered self-registers the service's node with its Registry, if
+// one was configured with WithRegistry, the first time the service starts
+// handling connections.
+func (service *service) ensureRegistered() {
+	if service.registry == nil {
+		return
+	}
+	service.registerOnce.Do(func() {
+		service.registry.Register(service.registryNode)
+	})
 }
 
 func (service *service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	service.ensureRegistered()
+
 	conn := newHTTPConn(w, r)
+	service.connCodecs.Store(conn, service.negotiateHTTPCodec(r))
+
 	sConn := &connection{
 		service:  service,
 		conn:     conn,
@@ -149,13 +247,62 @@ func (service *service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	service.handle(conn, sConn)
 }
 
+// negotiateHTTPCodec picks a Codec from the request's Content-Type, falling
+// back to Accept and then to the service's configured default.
+func (service *service) negotiateHTTPCodec(r *http.Request) Codec {
+	if name := contentTypeCodecName(r.Header.Get("Content-Type")); name != "" {
+		if c, ok := codecByName(name); ok {
+			return c
+		}
+	}
+	if name := contentTypeCodecName(r.Header.Get("Accept")); name != "" {
+		if c, ok := codecByName(name); ok {
+			return c
+		}
+	}
+	return service.codec
+}
+
+// negotiateConnCodec exchanges a codecHandshake frame, always JSON so both
+// sides can bootstrap before agreeing on anything else, and returns the
+// Codec to use for the rest of the connection.
+func (service *service) negotiateConnCodec(conn net.Conn) (Codec, error) {
+	if err := json.NewEncoder(conn).Encode(&codecHandshake{Codec: service.codec.Name()}); err != nil {
+		return nil, err
+	}
+
+	bootDecoder := json.NewDecoder(conn)
+	var hs codecHandshake
+	err := bootDecoder.Decode(&hs)
+	service.connReaders.Store(conn, io.MultiReader(bootDecoder.Buffered(), conn))
+	if err != nil {
+		return nil, err
+	}
+
+	if hs.Codec == service.codec.Name() {
+		return service.codec, nil
+	}
+	// The peers prefer different codecs: both fall back to JSON so that
+	// each side encodes with the codec the other decodes with.
+	return &jsonCodec{}, nil
+}
+
 // HandleConnection handles the lifetime of a connection
 func (service *service) HandleConnection(conn net.Conn, initFn func(Connection)) error {
+	service.ensureRegistered()
+
+	codec, err := service.negotiateConnCodec(conn)
+	if err != nil {
+		return err
+	}
+	service.connCodecs.Store(conn, codec)
+
 	sConn := &connection{
 		service:  service,
 		conn:     conn,
 		handling: true,
 	}
+	service.conns.Store(conn, sConn)
 
 	if initFn != nil {
 		initFn(sConn)
@@ -170,6 +317,7 @@ func (service *service) HandleConnection(conn net.Conn, initFn func(Connection))
 		}
 	}
 
+	service.finalizeConnection(sConn)
 	return nil
 }
 
@@ -179,6 +327,17 @@ func (service *service) initializeConnection(conn Connection) {
 func (service *service) finalizeConnection(conn Connection) {
 	service.connValues.Delete(conn)
 	service.connDecoders.Delete(conn)
+	service.conns.Delete(conn.GetRawConnection())
+	service.cancelCallsForConn(conn)
+
+	service.streamConsumers.Range(func(key, value interface{}) bool {
+		consumer := value.(*streamConsumer)
+		if consumer.conn == conn {
+			consumer.closeWithErr(&RPCError{Err: "connection closed"})
+			service.streamConsumers.Delete(key)
+		}
+		return true
+	})
 }
 
 func (service *service) newCall(promise *remotePromise) string {
@@ -191,37 +350,50 @@ func (service *service) newCall(promise *remotePromise) string {
 	}
 }
 
+func (service *service) newStreamCall(consumer *streamConsumer) string {
+	var callID int
+	for {
+		callID = rand.Int()
+		if _, exists := service.streamConsumers.LoadOrStore(strconv.Itoa(callID), consumer); !exists {
+			return strconv.Itoa(callID)
+		}
+	}
+}
+
 func (service *service) callRemoteFunc(conn Connection, fn string, args []reflect.Value, returnTypes []reflect.Type) {
 	nArgs := len(args) - 1
+	codec := service.codecFor(conn.GetRawConnection())
 	promise := &remotePromise{
 		conn:        conn,
+		codec:       codec,
 		returnTypes: returnTypes,
 		promiseFunc: args[nArgs],
 	}
 
-	var argVals []json.RawMessage
+	argVals := make([]interface{}, nArgs)
 	for j := 0; j < nArgs; j++ {
-		b, err := json.Marshal(args[j].Interface())
-		if err != nil {
-			promise.reject(err)
-			return
-		}
+		argVals[j] = args[j].Interface()
+	}
 
-		argVals = append(argVals, b)
+	raw, err := codec.Marshal(argVals)
+	if err != nil {
+		promise.reject(err)
+		return
 	}
 
-	callID := service.newCall(promise)
-	call := rpcCall{
-		CallID:   callID,
-		Args:     argVals,
-		FuncName: fn,
+	sendHandler := func(ctx context.Context, info CallInfo) ([]interface{}, error) {
+		callID := service.newCall(promise)
+		call := rpcCall{CallID: callID, Args: info.Args, FuncName: info.Method}
+		if err := service.send(conn.GetRawConnection(), &call); err != nil {
+			service.pendingCalls.Delete(callID)
+			return nil, err
+		}
+		return nil, nil
 	}
 
-	err := json.NewEncoder(conn.GetRawConnection()).Encode(call)
-	if err != nil {
-		service.pendingCalls.Delete(callID)
+	chained := chainInterceptors(service.interceptors, sendHandler)
+	if _, err := chained(context.Background(), CallInfo{Method: fn, Conn: conn, Args: Raw(raw)}); err != nil {
 		promise.reject(err)
-		return
 	}
 }
 
@@ -245,16 +417,30 @@ func (service *service) getConnValue(conn Connection, t reflect.Type) interface{
 	return newVal
 }
 
+// codecFor returns the Codec negotiated for conn, or the service's default
+// if none was negotiated (e.g. the connection predates negotiation).
+func (service *service) codecFor(conn net.Conn) Codec {
+	if v, ok := service.connCodecs.Load(conn); ok {
+		return v.(Codec)
+	}
+	return service.codec
+}
+
 func (service *service) send(conn net.Conn, v interface{}) error {
-	return json.NewEncoder(conn).Encode(v)
+	return service.codecFor(conn).NewEncoder(conn).Encode(v)
 }
 
-func (service *service) getDecoder(conn net.Conn) *json.Decoder {
+func (service *service) getDecoder(conn net.Conn) Decoder {
 	if v, ok := service.connDecoders.Load(conn); ok {
-		return v.(*json.Decoder)
+		return v.(Decoder)
 	}
 
-	decoder := json.NewDecoder(conn)
+	var r io.Reader = conn
+	if v, ok := service.connReaders.Load(conn); ok {
+		r = v.(io.Reader)
+	}
+
+	decoder := service.codecFor(conn).NewDecoder(r)
 	service.connDecoders.Store(conn, decoder)
 	return decoder
 }
@@ -284,27 +470,47 @@ func (service *service) handle(conn net.Conn, connection Connection) error {
 		return err
 	}
 
-	if msg.isCall() {
-		fn, ok := service.fnHandlers[msg.FuncName]
-		if !ok {
+	if msg.Kind == kindPublish {
+		return service.handlePublishFrame(connection, &msg)
+	} else if msg.isStream() {
+		return service.handleStreamFrame(conn, &msg)
+	} else if msg.isCall() {
+		if fn, ok := service.fnHandlers[msg.FuncName]; ok {
+			result, fnErr := fn(connection, msg.Args)
+			errString := ""
+			var data Raw
+			if fnErr != nil {
+				errString = fnErr.Error()
+			} else if len(result) > 0 {
+				b, marshalErr := service.codecFor(conn).Marshal(result)
+				if marshalErr != nil {
+					errString = (&RPCError{Err: "internal error", ActualErr: marshalErr}).Error()
+				} else {
+					data = Raw(b)
+				}
+			}
+
+			writeErr := service.send(conn, &rpcCallReturn{CallID: msg.CallID, Error: errString, Data: data})
+			if fnErr != nil { // prioritize function error
+				return fnErr
+			} else if writeErr != nil {
+				return &RPCError{ActualErr: writeErr}
+			}
+		} else if sh, ok := service.streamHandlers[msg.FuncName]; ok {
+			if err := sh(connection, msg.CallID, msg.Args); err != nil {
+				service.send(conn, &rpcCallReturn{CallID: msg.CallID, Error: err.Error()})
+				return err
+			}
+		} else if ch, ok := service.ctxHandlers[msg.FuncName]; ok {
+			if err := ch(connection, msg.CallID, msg.Args, msg.Timeout); err != nil {
+				service.send(conn, &rpcCallReturn{CallID: msg.CallID, Error: err.Error()})
+				return err
+			}
+		} else {
 			err := &RPCError{Err: "function not found"}
 			service.send(conn, &rpcCallReturn{CallID: msg.CallID, Error: err.Error()})
 			return err
 		}
-
-		result, err := fn(connection, msg.Args)
-		errString := ""
-		if err != nil {
-			errString = err.Error()
-			result = nil
-		}
-
-		writeErr := service.send(conn, &rpcCallReturn{CallID: msg.CallID, Error: errString, Data: result})
-		if err != nil { // prioritize function error
-			return err
-		} else if writeErr != nil {
-			return &RPCError{ActualErr: writeErr}
-		}
 	} else if msg.isResponse() {
 		promise, exists := service.getPendingCall(msg.CallID)
 		if exists {
@@ -336,8 +542,13 @@ func newService(apiPtr reflect.Value) *service {
 	}
 
 	return &service{
-		apiPtr:       apiPtr,
-		specialTypes: make(map[reflect.Type]func(Connection) interface{}),
-		fnHandlers:   make(map[string]func(conn Connection, args []json.RawMessage) ([]interface{}, error)),
+		apiPtr:         apiPtr,
+		codec:          &jsonCodec{},
+		specialTypes:   make(map[reflect.Type]func(Connection) interface{}),
+		fnHandlers:     make(map[string]func(conn Connection, args Raw) ([]interface{}, error)),
+		streamHandlers: make(map[string]func(conn Connection, callID string, args Raw) error),
+		ctxHandlers:    make(map[string]func(conn Connection, callID string, args Raw, timeoutMs int) error),
+		subscribers:    make(map[string]func(conn Connection, data Raw) error),
+		remoteTypes:    make(map[reflect.Type]bool),
 	}
 }
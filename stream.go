@@ -0,0 +1,169 @@
+package autorpc
+
+import (
+	"context"
+	"net"
+	"reflect"
+)
+
+// streamConsumer is the client-side end of a stream: it owns the channel
+// handed back to the caller and feeds it from incoming "s" frames until an
+// "e" frame (or a Cancel/connection close) closes it.
+type streamConsumer struct {
+	conn     Connection
+	codec    Codec
+	elemType reflect.Type
+	ch       reflect.Value // bidirectional chan elemType
+	closed   bool
+}
+
+func (c *streamConsumer) push(data Raw) error {
+	if c.closed || len(data) == 0 {
+		return nil
+	}
+
+	values, err := c.codec.Unmarshal(data, []reflect.Type{c.elemType})
+	if err != nil {
+		return &RPCError{Err: "internal error", ActualErr: err}
+	}
+
+	c.ch.Send(reflect.ValueOf(values[0]))
+	return nil
+}
+
+func (c *streamConsumer) close() {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.ch.Close()
+}
+
+// closeWithErr closes the consumer's channel; the stream protocol carries no
+// per-item error, so abrupt shutdown (connection closed, Cancel) is only
+// observable to the caller as an early channel close.
+func (c *streamConsumer) closeWithErr(err error) {
+	c.close()
+}
+
+// remoteStream is the Stream handle returned to a caller of a streaming
+// UseRemote function.
+type remoteStream struct {
+	service *service
+	conn    Connection
+	callID  string
+}
+
+func (s *remoteStream) Cancel() {
+	if v, ok := s.service.streamConsumers.Load(s.callID); ok {
+		v.(*streamConsumer).close()
+		s.service.streamConsumers.Delete(s.callID)
+	}
+
+	s.service.send(s.conn.GetRawConnection(), &rpcMessage{CallID: s.callID, Kind: kindStreamCancel})
+}
+
+func (service *service) handleStreamFrame(conn net.Conn, msg *rpcMessage) error {
+	switch msg.Kind {
+	case kindStreamItem:
+		if v, ok := service.streamConsumers.Load(msg.CallID); ok {
+			return v.(*streamConsumer).push(msg.Data)
+		}
+	case kindStreamEnd:
+		if v, ok := service.streamConsumers.Load(msg.CallID); ok {
+			v.(*streamConsumer).close()
+			service.streamConsumers.Delete(msg.CallID)
+		}
+	case kindStreamCancel:
+		if v, ok := service.streamCancels.Load(msg.CallID); ok {
+			v.(func())()
+			service.streamCancels.Delete(msg.CallID)
+		}
+		if v, ok := service.activeCalls.LoadAndDelete(msg.CallID); ok {
+			v.(*activeCall).cancel()
+		}
+	}
+	return nil
+}
+
+// callRemoteStream dispatches a streaming UseRemote call: it sends the
+// initial rpcCall, registers a streamConsumer under the new CallID and
+// immediately resolves the promise with the receive channel and a Stream
+// handle, since (unlike a regular call) there is no single response to wait
+// for. The initial send runs through the outbound interceptor chain, same as
+// a plain callRemoteFunc.
+func (service *service) callRemoteStream(conn Connection, fn string, args []reflect.Value, returnTypes []reflect.Type, chanIdx int, elemType reflect.Type) {
+	nArgs := len(args) - 1
+	promiseFunc := args[nArgs]
+	codec := service.codecFor(conn.GetRawConnection())
+
+	argVals := make([]interface{}, nArgs)
+	for j := 0; j < nArgs; j++ {
+		argVals[j] = args[j].Interface()
+	}
+
+	raw, err := codec.Marshal(argVals)
+	if err != nil {
+		callStreamPromise(promiseFunc, returnTypes, chanIdx, reflect.Value{}, nil, err)
+		return
+	}
+
+	chanType := reflect.ChanOf(reflect.BothDir, elemType)
+	ch := reflect.MakeChan(chanType, 16)
+	consumer := &streamConsumer{conn: conn, codec: codec, elemType: elemType, ch: ch}
+
+	callID := service.newStreamCall(consumer)
+	stream := &remoteStream{service: service, conn: conn, callID: callID}
+
+	sendHandler := func(ctx context.Context, info CallInfo) ([]interface{}, error) {
+		call := rpcCall{CallID: callID, Args: info.Args, FuncName: info.Method}
+		return nil, service.send(conn.GetRawConnection(), &call)
+	}
+
+	chained := chainInterceptors(service.interceptors, sendHandler)
+	if _, err := chained(context.Background(), CallInfo{Method: fn, Conn: conn, Args: Raw(raw)}); err != nil {
+		service.streamConsumers.Delete(callID)
+		callStreamPromise(promiseFunc, returnTypes, chanIdx, reflect.Value{}, nil, err)
+		return
+	}
+
+	callStreamPromise(promiseFunc, returnTypes, chanIdx, ch, stream, nil)
+}
+
+var streamType = reflect.TypeOf((*Stream)(nil)).Elem()
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// callStreamPromise builds the argument list for a streaming promise
+// function: the channel return goes in chanIdx, a Stream return (if present
+// in returnTypes) receives stream, everything else is zeroed, and the
+// trailing error argument carries err.
+func callStreamPromise(promiseFunc reflect.Value, returnTypes []reflect.Type, chanIdx int, chanVal reflect.Value, stream Stream, err error) {
+	n := len(returnTypes)
+	in := make([]reflect.Value, n+1)
+	for j, rt := range returnTypes {
+		switch {
+		case j == chanIdx:
+			if chanVal.IsValid() {
+				in[j] = chanVal.Convert(rt)
+			} else {
+				in[j] = reflect.Zero(rt)
+			}
+		case rt == streamType:
+			if stream != nil {
+				in[j] = reflect.ValueOf(stream)
+			} else {
+				in[j] = reflect.Zero(rt)
+			}
+		default:
+			in[j] = reflect.Zero(rt)
+		}
+	}
+
+	if err != nil {
+		in[n] = reflect.ValueOf(err)
+	} else {
+		in[n] = reflect.Zero(errorType)
+	}
+
+	promiseFunc.Call(in)
+}